@@ -0,0 +1,203 @@
+package cookiejar
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cascax/persistent-cookiejar/internal"
+)
+
+// fileStorage is the default Storage backend: a single file on the local
+// filesystem, guarded by an flock-style lock so that multiple processes
+// on the same machine don't clobber each other's writes.
+type fileStorage struct {
+	filename    string
+	keyring     Keyring
+	activeKeyID string
+	lockWait    time.Duration
+
+	// mu guards the fields below, which cache enough about the file as
+	// it stood after the last Load or Store to let Changed and Store
+	// skip redundant work; see their doc comments.
+	mu       sync.Mutex
+	hasLast  bool
+	lastInfo os.FileInfo
+	lastHash [sha256.Size]byte
+}
+
+// newFileStorage returns a Storage that persists entries to filename,
+// authenticating and (optionally) encrypting them under keyring. See
+// Options.LockWait for lockWait's meaning.
+func newFileStorage(filename string, keyring Keyring, activeKeyID string, lockWait time.Duration) *fileStorage {
+	return &fileStorage{
+		filename:    filename,
+		keyring:     keyring,
+		activeKeyID: activeKeyID,
+		lockWait:    lockWait,
+	}
+}
+
+// fileUnlocker adapts the io.Closer returned by internal.LockFileContext to the
+// Unlocker interface.
+type fileUnlocker struct {
+	closer io.Closer
+}
+
+func (u fileUnlocker) Unlock() error {
+	return u.closer.Close()
+}
+
+func (s *fileStorage) Lock(ctx context.Context) (Unlocker, error) {
+	if _, err := os.Stat(filepath.Dir(s.filename)); os.IsNotExist(err) {
+		// The directory that we'll store the cookie file in doesn't
+		// exist, so don't bother trying to acquire the lock.
+		return noopUnlocker{}, nil
+	}
+	closer, err := internal.LockFileContext(ctx, s.filename, s.lockOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return fileUnlocker{closer}, nil
+}
+
+// lockOptions translates s.lockWait into the internal.LockOption that
+// achieves it: none for the default 100ms wait, WithMaxWait(0) to wait
+// as long as ctx allows, or WithMaxWait(s.lockWait) for a custom bound.
+func (s *fileStorage) lockOptions() []internal.LockOption {
+	switch {
+	case s.lockWait == 0:
+		return nil
+	case s.lockWait < 0:
+		return []internal.LockOption{internal.WithMaxWait(0)}
+	default:
+		return []internal.LockOption{internal.WithMaxWait(s.lockWait)}
+	}
+}
+
+func (s *fileStorage) Load() ([]entry, error) {
+	f, err := os.Open(s.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := decodeEnvelope(bytes.NewReader(data), s.keyring)
+	if err != nil {
+		return nil, err
+	}
+	s.recordState(info, sha256.Sum256(data))
+	return entries, nil
+}
+
+// Changed implements ChangeDetector by comparing the file's current
+// size, modification time and identity (inode on Unix, file index on
+// Windows -- see os.SameFile) against what they were after the last Load
+// or Store. It reports changed if no Load or Store has recorded the
+// file's state yet (a Load of a missing file records none), or if the
+// file can't be stat'd, so callers fail open into doing the safe thing.
+func (s *fileStorage) Changed() (bool, error) {
+	s.mu.Lock()
+	lastInfo, hasLast := s.lastInfo, s.hasLast
+	s.mu.Unlock()
+	if !hasLast {
+		return true, nil
+	}
+	info, err := os.Stat(s.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return true, err
+	}
+	return !sameFileState(lastInfo, info), nil
+}
+
+func sameFileState(a, b os.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime()) && os.SameFile(a, b)
+}
+
+// Store writes entries to filename via a temporary file and os.Rename,
+// so a crash mid-write can never leave a corrupt, partially-written
+// cookie file behind. If the serialized output is identical to what's
+// already on disk, the write is skipped entirely.
+func (s *fileStorage) Store(entries []entry) error {
+	var buf bytes.Buffer
+	if err := encodeEnvelope(&buf, entries, s.keyring, s.activeKeyID); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	hash := sha256.Sum256(data)
+
+	if s.upToDate(hash) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.filename), filepath.Base(s.filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	_, writeErr := tmp.Write(data)
+	chmodErr := tmp.Chmod(0600)
+	closeErr := tmp.Close()
+	if writeErr != nil || chmodErr != nil || closeErr != nil {
+		os.Remove(tmpName)
+		if writeErr != nil {
+			return writeErr
+		}
+		if chmodErr != nil {
+			return chmodErr
+		}
+		return closeErr
+	}
+	if err := os.Rename(tmpName, s.filename); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if info, err := os.Stat(s.filename); err == nil {
+		s.recordState(info, hash)
+	}
+	return nil
+}
+
+// upToDate reports whether the file on disk already has hash as its
+// content, by checking that neither the file's identity nor its hash
+// have moved since the last Load or Store we did.
+func (s *fileStorage) upToDate(hash [sha256.Size]byte) bool {
+	s.mu.Lock()
+	lastInfo, lastHash, hasLast := s.lastInfo, s.lastHash, s.hasLast
+	s.mu.Unlock()
+	if !hasLast || lastHash != hash {
+		return false
+	}
+	info, err := os.Stat(s.filename)
+	if err != nil {
+		return false
+	}
+	return sameFileState(lastInfo, info)
+}
+
+func (s *fileStorage) recordState(info os.FileInfo, hash [sha256.Size]byte) {
+	s.mu.Lock()
+	s.lastInfo = info
+	s.lastHash = hash
+	s.hasLast = true
+	s.mu.Unlock()
+}
@@ -0,0 +1,148 @@
+package cookiejar
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cascax/persistent-cookiejar/internal"
+)
+
+func TestFileStorageChangedDetection(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cookies.json")
+	s := newFileStorage(filename, nil, "", 0)
+
+	changed, err := s.Changed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("Changed should report true before the first Load or Store")
+	}
+
+	if err := s.Store(nil); err != nil {
+		t.Fatal(err)
+	}
+	changed, err = s.Changed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Fatal("Changed should report false right after a Store")
+	}
+
+	if _, err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	changed, err = s.Changed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Fatal("Changed should report false right after a Load")
+	}
+
+	// An external write to the file should be detected.
+	if err := os.WriteFile(filename, []byte(`{"version":3,"payload":[]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	changed, err = s.Changed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("Changed should report true after the file is modified externally")
+	}
+}
+
+func TestFileStorageStoreSkipsUnchangedWrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cookies.json")
+	s := newFileStorage(filename, nil, "", 0)
+
+	if err := s.Store(nil); err != nil {
+		t.Fatal(err)
+	}
+	info1, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Storing the same (empty) entries again should not touch the file.
+	if err := s.Store(nil); err != nil {
+		t.Fatal(err)
+	}
+	info2, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info1.ModTime().Equal(info2.ModTime()) || info1.Size() != info2.Size() {
+		t.Fatalf("Store rewrote an unchanged file: before %v/%d, after %v/%d",
+			info1.ModTime(), info1.Size(), info2.ModTime(), info2.Size())
+	}
+}
+
+func TestFileStorageLockWaitsLongerThanDefaultWhenConfigured(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cookies.json")
+
+	held, err := internal.LockFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		held.Close()
+	}()
+
+	s := newFileStorage(filename, nil, "", 2*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	unlock, err := s.Lock(ctx)
+	if err != nil {
+		t.Fatalf("Lock with a 2s LockWait should outlast the other holder's 300ms, got: %v", err)
+	}
+	unlock.Unlock()
+}
+
+func TestFileStorageLockDefaultsToHundredMillisecondWait(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cookies.json")
+
+	held, err := internal.LockFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	s := newFileStorage(filename, nil, "", 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := s.Lock(ctx); err == nil {
+		t.Fatal("expected Lock to time out at the default ~100ms wait despite a 2s ctx deadline")
+	}
+}
+
+func TestFileStorageStoreIsAtomic(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cookies.json")
+	s := newFileStorage(filename, nil, "", 0)
+
+	if err := s.Store(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("got %d entries, want 0", len(entries))
+	}
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(filename), "*.tmp-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Fatalf("leftover temp file(s) after Store: %v", matches)
+	}
+}
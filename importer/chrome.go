@@ -0,0 +1,172 @@
+package importer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"net/http"
+	"time"
+
+	cookiejar "github.com/cascax/persistent-cookiejar"
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+)
+
+// chromeEpoch is the zero time WebKit/Chrome timestamps (microseconds
+// since 1601-01-01 UTC) are measured from.
+var chromeEpoch = time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// FromChrome populates jar with the cookies in a Chrome (or
+// Chromium/Edge/Brave) profile directory -- the directory containing
+// that profile's "Cookies" sqlite database, typically something like
+// "~/.config/google-chrome/Default".
+//
+// encrypted_value entries are decrypted using the OS-specific key
+// Chrome itself protects them with: DPAPI on Windows, the macOS
+// Keychain, or libsecret on Linux. See chromeKey in the platform-specific
+// files for how that key is obtained.
+func FromChrome(profileDir string, jar *cookiejar.Jar) error {
+	key, err := chromeKey(profileDir)
+	if err != nil {
+		return err
+	}
+	db, err := openReadOnly(profileDir + "/Cookies")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	results, err := db.Query(`SELECT host_key, name, value, encrypted_value, path, expires_utc, is_secure, is_httponly, samesite FROM cookies`)
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	var rows []cookieRow
+	for results.Next() {
+		var (
+			hostKey, name, value, path string
+			encryptedValue             []byte
+			expiresUTC                 int64
+			isSecure, isHTTPOnly       bool
+			sameSite                   int
+		)
+		if err := results.Scan(&hostKey, &name, &value, &encryptedValue, &path, &expiresUTC, &isSecure, &isHTTPOnly, &sameSite); err != nil {
+			return err
+		}
+		if len(encryptedValue) > 0 {
+			value, err = decryptChromeValue(encryptedValue, key)
+			if err != nil {
+				// Skip cookies we can't decrypt rather than
+				// failing the whole import.
+				continue
+			}
+		}
+		var expires time.Time
+		if expiresUTC != 0 {
+			// expires_utc is 0 for session cookies, which have no
+			// declared expiry rather than already having expired.
+			expires = chromeEpoch.Add(time.Duration(expiresUTC) * time.Microsecond)
+		}
+		rows = append(rows, cookieRow{
+			Host:     hostKey,
+			Name:     name,
+			Value:    value,
+			Path:     path,
+			Expires:  expires,
+			Secure:   isSecure,
+			HTTPOnly: isHTTPOnly,
+			SameSite: chromeSameSite(sameSite),
+		})
+	}
+	if err := results.Err(); err != nil {
+		return err
+	}
+	return addRows(jar, rows)
+}
+
+// chromeSameSite maps Chrome's CookieSameSite enum (-1 unspecified, 0
+// none, 1 lax, 2 strict) to the net/http equivalent.
+func chromeSameSite(v int) http.SameSite {
+	switch v {
+	case 0:
+		return http.SameSiteNoneMode
+	case 1:
+		return http.SameSiteLaxMode
+	case 2:
+		return http.SameSiteStrictMode
+	default:
+		return http.SameSiteDefaultMode
+	}
+}
+
+// decryptChromeValue decrypts a Chrome encrypted_value. Chrome prefixes
+// the ciphertext with "v10" or "v11" (the scheme version); anything else
+// is returned unchanged, matching older unencrypted rows. Two distinct
+// constructions share that prefix: macOS/Linux derive a 16-byte key and
+// use AES-128-CBC with a fixed IV of 16 spaces, while Windows (v80+)
+// derives a 32-byte key via DPAPI and uses AES-256-GCM (12-byte nonce +
+// ciphertext + 16-byte tag) instead -- see chromeKey in the
+// platform-specific files. We dispatch on the key length chromeKey gave
+// us rather than GOOS, since that's what actually determines the wire
+// format.
+func decryptChromeValue(encryptedValue []byte, key []byte) (string, error) {
+	if len(encryptedValue) < 3 || (string(encryptedValue[:3]) != "v10" && string(encryptedValue[:3]) != "v11") {
+		return string(encryptedValue), nil
+	}
+	ciphertext := encryptedValue[3:]
+	if len(key) == 32 {
+		return decryptChromeValueGCM(ciphertext, key)
+	}
+	return decryptChromeValueCBC(ciphertext, key)
+}
+
+// decryptChromeValueGCM decrypts the AES-256-GCM scheme Chrome uses on
+// Windows, where key is the 32-byte value DPAPI unprotected.
+func decryptChromeValueGCM(ciphertext []byte, key []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return "", errors.New("encrypted_value too short for AES-GCM")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errors.WithMessage(err, "AES-GCM decrypt error")
+	}
+	return string(plaintext), nil
+}
+
+// decryptChromeValueCBC decrypts the AES-128-CBC scheme Chrome uses on
+// macOS and Linux, where key is the 16-byte value PBKDF2-derived from
+// the Keychain/libsecret password.
+func decryptChromeValueCBC(ciphertext []byte, key []byte) (string, error) {
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		// Not a valid CBC ciphertext for this block size -- report it
+		// rather than letting CryptBlocks panic on a foreign length.
+		return "", errors.New("encrypted_value is not a multiple of the AES block size")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	iv := bytes.Repeat([]byte{' '}, aes.BlockSize)
+	mode := cipher.NewCBCDecrypter(block, iv)
+	plaintext := make([]byte, len(ciphertext))
+	mode.CryptBlocks(plaintext, ciphertext)
+
+	// Strip PKCS7 padding.
+	if n := len(plaintext); n > 0 {
+		pad := int(plaintext[n-1])
+		if pad > 0 && pad <= aes.BlockSize && pad <= n {
+			plaintext = plaintext[:n-pad]
+		}
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,22 @@
+package importer
+
+import (
+	"crypto/sha1"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// chromeKey derives Chrome's AES-128-CBC value-encryption key from the
+// password it stores in the macOS Keychain under "Chrome Safe Storage",
+// using the same PBKDF2 parameters Chromium itself uses.
+func chromeKey(profileDir string) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-w", "-s", "Chrome Safe Storage").Output()
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot read Chrome Safe Storage password from Keychain")
+	}
+	password := strings.TrimRight(string(out), "\n")
+	return pbkdf2.Key([]byte(password), []byte("saltysalt"), 1003, 16, sha1.New), nil
+}
@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+)
+
+func TestDecryptChromeValueCBCRoundTrip(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	plaintext := []byte("cookie-value")
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), make([]byte, pad)...)
+	for i := len(padded) - pad; i < len(padded); i++ {
+		padded[i] = byte(pad)
+	}
+	ciphertext := make([]byte, len(padded))
+	iv := make([]byte, aes.BlockSize)
+	for i := range iv {
+		iv[i] = ' '
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	got, err := decryptChromeValue(append([]byte("v10"), ciphertext...), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(plaintext) {
+		t.Fatalf("got %q, want %q", got, plaintext)
+	}
+}
+
+func TestDecryptChromeValueCBCDoesNotPanicOnForeignLength(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	// 37 bytes after the "v10" prefix: not a multiple of aes.BlockSize,
+	// the shape a GCM payload (nonce+ciphertext+tag) usually has.
+	encryptedValue := append([]byte("v10"), make([]byte, 37)...)
+	if _, err := decryptChromeValue(encryptedValue, key); err == nil {
+		t.Fatal("expected an error, not a panic, for a non-block-aligned CBC ciphertext")
+	}
+}
+
+func TestDecryptChromeValueGCMRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("windows-cookie-value")
+	sealed := gcm.Seal(nil, nonce, plaintext, nil)
+	encryptedValue := append([]byte("v10"), append(nonce, sealed...)...)
+
+	got, err := decryptChromeValue(encryptedValue, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(plaintext) {
+		t.Fatalf("got %q, want %q", got, plaintext)
+	}
+}
@@ -0,0 +1,64 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// chromeLocalState is the subset of "Local State" (the JSON file in
+// Chrome's top-level user-data directory, one level above a profile
+// directory like "Default") that holds the DPAPI-protected AES key used
+// for that installation's encrypted_value columns.
+type chromeLocalState struct {
+	OSCrypt struct {
+		EncryptedKey string `json:"encrypted_key"`
+	} `json:"os_crypt"`
+}
+
+// dpapiKeyPrefix is the marker Chrome prepends to the DPAPI-protected key
+// before base64-encoding it in Local State.
+var dpapiKeyPrefix = []byte("DPAPI")
+
+// chromeKey derives Chrome's AES value-encryption key on Windows by
+// reading the DPAPI-protected key out of Local State and unprotecting it
+// with CryptUnprotectData, which only succeeds when called as the same
+// Windows user who encrypted it.
+func chromeKey(profileDir string) ([]byte, error) {
+	localStatePath := filepath.Join(filepath.Dir(profileDir), "Local State")
+	data, err := os.ReadFile(localStatePath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot read Local State")
+	}
+	var state chromeLocalState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.WithMessage(err, "cannot parse Local State")
+	}
+	encryptedKey, err := base64.StdEncoding.DecodeString(state.OSCrypt.EncryptedKey)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot decode encrypted_key")
+	}
+	if len(encryptedKey) < len(dpapiKeyPrefix) || string(encryptedKey[:len(dpapiKeyPrefix)]) != string(dpapiKeyPrefix) {
+		return nil, errors.New("encrypted_key is missing the DPAPI prefix")
+	}
+	return dpapiUnprotect(encryptedKey[len(dpapiKeyPrefix):])
+}
+
+// dpapiUnprotect calls into crypt32.dll's CryptUnprotectData to decrypt
+// data that was protected for the current Windows user.
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, 0, &out); err != nil {
+		return nil, errors.WithMessage(err, "CryptUnprotectData failed")
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	key := make([]byte, out.Size)
+	copy(key, unsafe.Slice(out.Data, out.Size))
+	return key, nil
+}
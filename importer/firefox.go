@@ -0,0 +1,76 @@
+package importer
+
+import (
+	"net/http"
+	"time"
+
+	cookiejar "github.com/cascax/persistent-cookiejar"
+	_ "modernc.org/sqlite"
+)
+
+// FromFirefox populates jar with the cookies in a Firefox profile
+// directory -- the directory containing that profile's "cookies.sqlite"
+// database, typically something like
+// "~/.mozilla/firefox/xxxxxxxx.default".
+//
+// Unlike Chrome, Firefox stores cookie values in cookies.sqlite as
+// plain text, so there is no OS keychain to go through.
+func FromFirefox(profileDir string, jar *cookiejar.Jar) error {
+	db, err := openReadOnly(profileDir + "/cookies.sqlite")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	results, err := db.Query(`SELECT host, name, value, path, expiry, isSecure, isHttpOnly, sameSite FROM moz_cookies`)
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	var rows []cookieRow
+	for results.Next() {
+		var (
+			host, name, value, path string
+			expiry                  int64
+			isSecure, isHTTPOnly    bool
+			sameSite                int
+		)
+		if err := results.Scan(&host, &name, &value, &path, &expiry, &isSecure, &isHTTPOnly, &sameSite); err != nil {
+			return err
+		}
+		var expires time.Time
+		if expiry != 0 {
+			// expiry is 0 for session cookies, which have no
+			// declared expiry rather than already having expired.
+			expires = time.Unix(expiry, 0)
+		}
+		rows = append(rows, cookieRow{
+			Host:     host,
+			Name:     name,
+			Value:    value,
+			Path:     path,
+			Expires:  expires,
+			Secure:   isSecure,
+			HTTPOnly: isHTTPOnly,
+			SameSite: firefoxSameSite(sameSite),
+		})
+	}
+	if err := results.Err(); err != nil {
+		return err
+	}
+	return addRows(jar, rows)
+}
+
+// firefoxSameSite maps Firefox's moz_cookies.sameSite enum (0 none, 1
+// lax, 2 strict) to the net/http equivalent.
+func firefoxSameSite(v int) http.SameSite {
+	switch v {
+	case 1:
+		return http.SameSiteLaxMode
+	case 2:
+		return http.SameSiteStrictMode
+	default:
+		return http.SameSiteNoneMode
+	}
+}
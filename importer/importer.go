@@ -0,0 +1,77 @@
+// Package importer populates a cookiejar.Jar from an existing browser
+// profile, so a program can pick up a user's real browser session
+// instead of driving a fresh login.
+package importer
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	cookiejar "github.com/cascax/persistent-cookiejar"
+)
+
+// cookieRow is the subset of a browser's cookie store that importer can
+// populate a http.Cookie from.
+type cookieRow struct {
+	Host     string
+	Name     string
+	Value    string
+	Path     string
+	Expires  time.Time
+	Secure   bool
+	HTTPOnly bool
+	SameSite http.SameSite
+}
+
+// addRows turns rows into http.Cookie values and feeds them into jar
+// through its normal SetCookies entry point, one call per row so that
+// each cookie picks up the domain and scheme it actually belongs to.
+func addRows(jar *cookiejar.Jar, rows []cookieRow) error {
+	for _, row := range rows {
+		scheme := "http"
+		if row.Secure {
+			scheme = "https"
+		}
+		// Chrome's host_key and Firefox's host columns prefix a
+		// domain-wide cookie's host with a leading dot; strip it and
+		// pass it along as Domain so SetCookies scopes the cookie to
+		// the whole domain instead of treating the dot as part of a
+		// literal (and unmatchable) host-only name.
+		host := row.Host
+		domain := ""
+		if strings.HasPrefix(host, ".") {
+			domain = host[1:]
+			host = domain
+		}
+		u := &url.URL{Scheme: scheme, Host: host, Path: "/"}
+		maxAge := 0
+		if !row.Expires.IsZero() {
+			if d := time.Until(row.Expires); d > 0 {
+				maxAge = int(d.Seconds())
+			} else {
+				continue // already expired; nothing to import
+			}
+		}
+		jar.SetCookies(u, []*http.Cookie{{
+			Name:     row.Name,
+			Value:    row.Value,
+			Domain:   domain,
+			Path:     row.Path,
+			Secure:   row.Secure,
+			HttpOnly: row.HTTPOnly,
+			SameSite: row.SameSite,
+			MaxAge:   maxAge,
+		}})
+	}
+	return nil
+}
+
+// openReadOnly opens the sqlite file at path for reading without
+// requiring exclusive access, since the browser that owns it may still
+// have it open.
+func openReadOnly(path string) (*sql.DB, error) {
+	return sql.Open("sqlite", "file:"+path+"?mode=ro&immutable=0")
+}
@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	cookiejar "github.com/cascax/persistent-cookiejar"
+)
+
+func TestAddRowsImportsSessionCookies(t *testing.T) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Expires left zero-valued, as chrome.go/firefox.go now do for rows
+	// whose expires_utc/expiry is 0 -- i.e. a session cookie, not one
+	// that already expired.
+	rows := []cookieRow{{
+		Host:  "example.com",
+		Name:  "session",
+		Value: "v",
+		Path:  "/",
+	}}
+	if err := addRows(jar, rows); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("http://example.com/")
+	got := jar.Cookies(u)
+	if len(got) != 1 || got[0].Value != "v" {
+		t.Fatalf("got %#v, want one session cookie with value %q", got, "v")
+	}
+}
+
+func TestAddRowsScopesLeadingDotHostToWholeDomain(t *testing.T) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []cookieRow{{
+		Host:  ".example.com",
+		Name:  "session",
+		Value: "v",
+		Path:  "/",
+	}}
+	if err := addRows(jar, rows); err != nil {
+		t.Fatal(err)
+	}
+	for _, rawURL := range []string{"https://example.com/", "https://sub.example.com/"} {
+		u, _ := url.Parse(rawURL)
+		got := jar.Cookies(u)
+		if len(got) != 1 || got[0].Value != "v" {
+			t.Fatalf("Cookies(%q) = %#v, want one cookie with value %q", rawURL, got, "v")
+		}
+	}
+}
+
+func TestAddRowsSkipsExpiredCookies(t *testing.T) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []cookieRow{{
+		Host:    "example.com",
+		Name:    "stale",
+		Value:   "v",
+		Path:    "/",
+		Expires: time.Now().Add(-time.Hour),
+	}}
+	if err := addRows(jar, rows); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("http://example.com/")
+	if got := jar.Cookies(u); len(got) != 0 {
+		t.Fatalf("got %#v, want no cookies for an already-expired row", got)
+	}
+}
@@ -18,11 +18,67 @@ var lockFileName = func(path string) string {
 	return path
 }
 
-func LockFile(path string) (io.Closer, error) {
+// defaultMaxWait and defaultPollInterval reproduce the timeout LockFile
+// hard-coded before it took a context and LockOptions.
+const (
+	defaultMaxWait      = 100 * time.Millisecond
+	defaultPollInterval = 100 * time.Microsecond
+)
+
+// lockOptions holds the settings controlled by a LockOption.
+type lockOptions struct {
+	maxWait      time.Duration
+	pollInterval time.Duration
+	shared       bool
+}
+
+// LockOption configures a LockFileContext call. See WithMaxWait,
+// WithPollInterval and WithShared.
+type LockOption func(*lockOptions)
+
+// WithMaxWait bounds how long LockFileContext will wait to acquire the
+// lock before giving up, on top of whatever deadline ctx already
+// carries. A non-positive d disables this bound, so LockFileContext
+// waits as long as ctx allows.
+func WithMaxWait(d time.Duration) LockOption {
+	return func(o *lockOptions) { o.maxWait = d }
+}
+
+// WithPollInterval sets how often LockFileContext retries acquiring the
+// lock while it waits.
+func WithPollInterval(d time.Duration) LockOption {
+	return func(o *lockOptions) { o.pollInterval = d }
+}
+
+// WithShared requests a shared (read) lock instead of the default
+// exclusive (write) lock, so multiple holders can hold it at once.
+func WithShared() LockOption {
+	return func(o *lockOptions) { o.shared = true }
+}
+
+// LockFileContext acquires a lock on path, blocking until it is
+// acquired, ctx is done, or the wait exceeds WithMaxWait (100ms by
+// default). The returned io.Closer releases the lock.
+func LockFileContext(ctx context.Context, path string, opts ...LockOption) (io.Closer, error) {
+	o := lockOptions{
+		maxWait:      defaultMaxWait,
+		pollInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.maxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.maxWait)
+		defer cancel()
+	}
+
 	lock := flock.New(lockFileName(path))
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
-	defer cancel()
-	_, err := lock.TryLockContext(ctx, 100*time.Microsecond)
+	tryLock := lock.TryLockContext
+	if o.shared {
+		tryLock = lock.TryRLockContext
+	}
+	_, err := tryLock(ctx, o.pollInterval)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
 			return nil, errors.New("try lock timeout")
@@ -31,3 +87,10 @@ func LockFile(path string) (io.Closer, error) {
 	}
 	return newCloser(lock), nil
 }
+
+// LockFile acquires an exclusive lock on path, waiting up to the
+// default 100ms. It is a thin wrapper around LockFileContext for
+// callers that don't need to plumb a context through.
+func LockFile(path string) (io.Closer, error) {
+	return LockFileContext(context.Background(), path)
+}
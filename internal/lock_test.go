@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -43,3 +44,48 @@ func TestLockFile(t *testing.T) {
 		t.Errorf("expected no running goroutines left")
 	}
 }
+
+func TestLockFileContextRespectsCancellation(t *testing.T) {
+	d, err := ioutil.TempDir("", "cookiejar_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	filename := filepath.Join(d, "lockfile")
+
+	held, err := LockFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := LockFileContext(ctx, filename, WithMaxWait(0)); err == nil {
+		t.Error("expected LockFileContext to fail against an already-cancelled context")
+	}
+}
+
+func TestLockFileContextWithMaxWait(t *testing.T) {
+	d, err := ioutil.TempDir("", "cookiejar_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	filename := filepath.Join(d, "lockfile")
+
+	held, err := LockFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	start := time.Now()
+	_, err = LockFileContext(context.Background(), filename, WithMaxWait(20*time.Millisecond))
+	if err == nil {
+		t.Fatal("expected LockFileContext to time out while the lock is held")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("LockFileContext took %v to time out, want well under 1s", elapsed)
+	}
+}
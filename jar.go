@@ -0,0 +1,709 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cookiejar implements an in-memory RFC 6265-compliant http.CookieJar
+// that can also persist its cookies to disk between process runs.
+package cookiejar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// PublicSuffixList provides the public suffix of a domain. For example:
+//   - the public suffix of "example.com" is "com",
+//   - the public suffix of "foo1.foo2.foo3.co.uk" is "co.uk", and
+//   - the public suffix of "bar.pvt.k12.ma.us" is "pvt.k12.ma.us".
+//
+// Implementations of PublicSuffixList must be safe for concurrent use by
+// multiple goroutines.
+//
+// An implementation that always returns "" is valid and may be useful for
+// testing but it is not secure: it means that the HTTP server for foo.com can
+// set a cookie for bar.com.
+//
+// A public suffix list implementation is in the package
+// golang.org/x/net/publicsuffix.
+type PublicSuffixList interface {
+	// PublicSuffix returns the public suffix of domain.
+	PublicSuffix(domain string) string
+
+	// String returns a description of the source of this public suffix
+	// list. The description will typically contain something like a time
+	// stamp or version number.
+	String() string
+}
+
+// Options are the options for creating a new Jar.
+type Options struct {
+	// PublicSuffixList is the public suffix list that determines whether
+	// an HTTP server can set a cookie for a domain.
+	//
+	// A nil value is valid and may be useful for testing but it is not
+	// secure: it means that the HTTP server for foo.co.uk can set a cookie
+	// for bar.co.uk.
+	PublicSuffixList PublicSuffixList
+
+	// Filename holds the file to use for storage of the cookies.
+	// If this is empty, the jar is not persistent and cookies
+	// are kept in memory only.
+	Filename string
+
+	// PasswordEncryptKey, if set, is used to derive the AES-GCM key
+	// used to encrypt persisted cookie values. It is called once
+	// when the jar is created.
+	PasswordEncryptKey func() ([]byte, error)
+
+	// Keyring holds the set of keys a persisted cookie file may be
+	// authenticated and encrypted with, indexed by key ID. If set, it
+	// takes precedence over PasswordEncryptKey and enables the
+	// authenticated on-disk envelope described in writeTo/mergeFrom.
+	Keyring Keyring
+
+	// ActiveKeyID selects the entry of Keyring used to write new files.
+	// Older entries remain usable for reading until the file is next
+	// saved, which rewrites it under ActiveKeyID. Required if Keyring
+	// is set.
+	ActiveKeyID string
+
+	// Storage is the persistence backend to use. If set, it takes
+	// precedence over Filename. Use this to share a Jar's cookies
+	// across processes or machines via a backend other than the
+	// local filesystem.
+	Storage Storage
+
+	// LockWait bounds how long the default file Storage (see Filename)
+	// will wait to acquire its lock before giving up, on top of
+	// whatever deadline a SaveContext/loadContext caller's ctx already
+	// carries. Zero, the default, waits up to 100ms, matching the
+	// lock's behavior before it took a context. A negative value
+	// removes this bound entirely, so a save waits as long as ctx
+	// allows -- useful under contention, where 100ms is often too
+	// short. Ignored when Storage is set instead of Filename.
+	LockWait time.Duration
+}
+
+// Jar implements the http.CookieJar interface from the net/http package.
+// It persists its cookies through its Storage when one is configured.
+type Jar struct {
+	psList PublicSuffixList
+
+	// storage is the persistence backend for the jar's cookies, or nil
+	// if the jar does not persist its cookies.
+	storage Storage
+
+	// encryptedKey, if non-empty, is used to encrypt and decrypt the
+	// Value of persistent entries before they touch disk.
+	encryptedKey []byte
+
+	// keyring and activeKeyID, if keyring is non-empty, select the keys
+	// used to authenticate (and optionally encrypt) the persisted file
+	// as a whole. See writeTo and mergeFrom.
+	keyring     Keyring
+	activeKeyID string
+
+	// mu locks the remaining fields.
+	mu sync.Mutex
+
+	// entries is a set of entries, keyed by their eTLD+1 and subkeyed by
+	// their name/domain/path.
+	entries map[string]map[string]entry
+
+	// nextSeqNum is the next sequence number assigned to a new cookie
+	// created by SetCookies.
+	nextSeqNum uint64
+}
+
+// New returns a new cookie jar. A nil *Options is equivalent to a zero
+// Options.
+//
+// If o.Storage or o.Filename is set, New attempts to load any cookies
+// already persisted there before returning.
+func New(o *Options) (*Jar, error) {
+	jar := &Jar{
+		entries: make(map[string]map[string]entry),
+	}
+	if o != nil {
+		jar.psList = o.PublicSuffixList
+		if o.PasswordEncryptKey != nil {
+			key, err := o.PasswordEncryptKey()
+			if err != nil {
+				return nil, fmt.Errorf("cannot derive encryption key: %v", err)
+			}
+			jar.encryptedKey = key
+		}
+		if len(o.Keyring) > 0 {
+			if _, ok := o.Keyring[o.ActiveKeyID]; !ok {
+				return nil, fmt.Errorf("active key ID %q not found in keyring", o.ActiveKeyID)
+			}
+			jar.keyring = o.Keyring
+			jar.activeKeyID = o.ActiveKeyID
+		}
+		switch {
+		case o.Storage != nil:
+			jar.storage = o.Storage
+		case o.Filename != "":
+			jar.storage = newFileStorage(o.Filename, jar.keyring, jar.activeKeyID, o.LockWait)
+		}
+	}
+	if jar.storage != nil {
+		if err := jar.load(); err != nil {
+			return nil, err
+		}
+	}
+	return jar, nil
+}
+
+// entry is the internal representation of a cookie.
+//
+// This struct type is not used outside of this package per se, but the
+// exported fields are those of RFC 6265, plus the bookkeeping needed to
+// persist entries to disk.
+type entry struct {
+	Name           string
+	Value          string
+	EncryptedValue string `json:",omitempty"`
+	Domain         string
+	Path           string
+	SameSite       http.SameSite
+	Secure         bool
+	HttpOnly       bool
+	Persistent     bool
+	HostOnly       bool
+	Expires        time.Time
+	Creation       time.Time
+	LastAccess     time.Time
+
+	// Partitioned records whether this cookie was set with the CHIPS
+	// "Partitioned" attribute, and PartitionKey is the site it's
+	// partitioned under. A partitioned cookie is only sent back for a
+	// request whose site matches PartitionKey.
+	//
+	// net/http's CookieJar interface only ever gives us the resource's
+	// own URL, never the embedding top-level site, so PartitionKey can
+	// only be derived from the cookie's own site (see newEntry). That
+	// still gives correct persistence and round-tripping of the
+	// attribute even though it can't express true cross-site
+	// partitioning at this layer.
+	Partitioned  bool
+	PartitionKey string `json:",omitempty"`
+
+	// seqNum is a sequence number so that Cookies returns cookies in a
+	// deterministic order, even for cookies that have equal Path length
+	// and equal Creation time. This simplifies testing.
+	seqNum uint64
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting both the current
+// numeric encoding of SameSite and the string encoding ("SameSite",
+// "SameSite=Strict", "SameSite=Lax") written by versions prior to
+// formatVersion 3, so that old cookie files keep decoding correctly.
+func (e *entry) UnmarshalJSON(data []byte) error {
+	type entryAlias entry
+	aux := struct {
+		SameSite json.RawMessage
+		*entryAlias
+	}{entryAlias: (*entryAlias)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if len(aux.SameSite) == 0 || string(aux.SameSite) == "null" {
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(aux.SameSite, &n); err == nil {
+		e.SameSite = http.SameSite(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(aux.SameSite, &s); err != nil {
+		return err
+	}
+	switch s {
+	case "SameSite":
+		e.SameSite = http.SameSiteDefaultMode
+	case "SameSite=Strict":
+		e.SameSite = http.SameSiteStrictMode
+	case "SameSite=Lax":
+		e.SameSite = http.SameSiteLaxMode
+	}
+	return nil
+}
+
+// id returns the domain;path;name triple of e as an id.
+func (e *entry) id() string {
+	return fmt.Sprintf("%s;%s;%s", e.Domain, e.Path, e.Name)
+}
+
+// shouldSend determines whether e's cookie qualifies to be included in a
+// request to host/path. It is the caller's responsibility to check if the
+// cookie is expired.
+func (e *entry) shouldSend(https bool, host, path, partitionKey string) bool {
+	return e.domainMatch(host) && e.pathMatch(path) && (https || !e.Secure) && e.partitionMatch(partitionKey)
+}
+
+// partitionMatch reports whether e may be sent for a request whose site
+// is partitionKey. Unpartitioned cookies always match.
+func (e *entry) partitionMatch(partitionKey string) bool {
+	return !e.Partitioned || e.PartitionKey == partitionKey
+}
+
+// domainMatch checks whether e's Domain allows sending e back to host.
+func (e *entry) domainMatch(host string) bool {
+	if e.Domain == host {
+		return true
+	}
+	return !e.HostOnly && hasDotSuffix(host, e.Domain)
+}
+
+// pathMatch implements "path-match" according to RFC 6265 section 5.1.4.
+func (e *entry) pathMatch(requestPath string) bool {
+	if requestPath == e.Path {
+		return true
+	}
+	if strings.HasPrefix(requestPath, e.Path) {
+		if e.Path[len(e.Path)-1] == '/' {
+			return true // The "/any/" matches "/any/path" case.
+		} else if requestPath[len(e.Path)] == '/' {
+			return true // The "/any" matches "/any/path" case.
+		}
+	}
+	return false
+}
+
+// hasDotSuffix reports whether s ends in "."+suffix.
+func hasDotSuffix(s, suffix string) bool {
+	return len(s) > len(suffix) && s[len(s)-len(suffix)-1] == '.' && s[len(s)-len(suffix):] == suffix
+}
+
+// byCanonicalHost sorts entries primarily by canonical host name and
+// secondarily by path length, longest first.
+type byCanonicalHost struct {
+	entries []entry
+}
+
+func (s byCanonicalHost) Len() int      { return len(s.entries) }
+func (s byCanonicalHost) Swap(i, j int) { s.entries[i], s.entries[j] = s.entries[j], s.entries[i] }
+func (s byCanonicalHost) Less(i, j int) bool {
+	e1, e2 := s.entries[i], s.entries[j]
+	if e1.Domain != e2.Domain {
+		return e1.Domain < e2.Domain
+	}
+	return len(e1.Path) > len(e2.Path)
+}
+
+var _ sort.Interface = byCanonicalHost{}
+
+// Cookies implements the Cookies method of the http.CookieJar interface.
+//
+// It returns an empty slice if the URL's scheme is not HTTP or HTTPS.
+func (j *Jar) Cookies(u *url.URL) (cookies []*http.Cookie) {
+	return j.cookies(u, time.Now())
+}
+
+// cookies is like Cookies but takes the current time as a parameter.
+func (j *Jar) cookies(u *url.URL, now time.Time) (cookies []*http.Cookie) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return cookies
+	}
+	host, err := canonicalHost(u.Host)
+	if err != nil {
+		return cookies
+	}
+	key := jarKey(host, j.psList)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	submap := j.entries[key]
+	if submap == nil {
+		return cookies
+	}
+
+	https := u.Scheme == "https"
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	modified := false
+	var selected []entry
+	for id, e := range submap {
+		if e.Persistent && !e.Expires.After(now) {
+			delete(submap, id)
+			modified = true
+			continue
+		}
+		if !e.shouldSend(https, host, path, key) {
+			continue
+		}
+		e.LastAccess = now
+		submap[id] = e
+		selected = append(selected, e)
+		modified = true
+	}
+	if modified {
+		if len(submap) == 0 {
+			delete(j.entries, key)
+		} else {
+			j.entries[key] = submap
+		}
+	}
+
+	sort.Slice(selected, func(i, k int) bool {
+		s := selected
+		if len(s[i].Path) != len(s[k].Path) {
+			return len(s[i].Path) > len(s[k].Path)
+		}
+		if !s[i].Creation.Equal(s[k].Creation) {
+			return s[i].Creation.Before(s[k].Creation)
+		}
+		return s[i].seqNum < s[k].seqNum
+	})
+	for _, e := range selected {
+		cookies = append(cookies, &http.Cookie{Name: e.Name, Value: e.Value})
+	}
+
+	return cookies
+}
+
+// SetCookies implements the SetCookies method of the http.CookieJar interface.
+//
+// It does nothing if the URL's scheme is not HTTP or HTTPS.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.setCookies(u, cookies, time.Now())
+}
+
+// setCookies is like SetCookies but takes the current time as parameter.
+func (j *Jar) setCookies(u *url.URL, cookies []*http.Cookie, now time.Time) {
+	if len(cookies) == 0 {
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return
+	}
+	host, err := canonicalHost(u.Host)
+	if err != nil {
+		return
+	}
+	key := jarKey(host, j.psList)
+	defPath := defaultPath(u.Path)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	submap := j.entries[key]
+
+	modified := false
+	for _, cookie := range cookies {
+		e, remove, err := j.newEntry(cookie, now, defPath, host)
+		if err != nil {
+			continue
+		}
+		id := e.id()
+		if remove {
+			if submap != nil {
+				if _, ok := submap[id]; ok {
+					delete(submap, id)
+					modified = true
+				}
+			}
+			continue
+		}
+		if submap == nil {
+			submap = make(map[string]entry)
+		}
+
+		if old, ok := submap[id]; ok {
+			e.Creation = old.Creation
+			e.seqNum = old.seqNum
+		} else {
+			e.Creation = now
+			e.seqNum = j.nextSeqNum
+			j.nextSeqNum++
+		}
+		e.LastAccess = now
+		submap[id] = e
+		modified = true
+	}
+
+	if modified {
+		if len(submap) == 0 {
+			delete(j.entries, key)
+		} else {
+			j.entries[key] = submap
+		}
+	}
+}
+
+// merge merges the given entries into j. When both sides hold the same
+// cookie id, the entry already in j is kept only if its LastAccess is
+// later than the incoming entry's; otherwise the incoming entry wins.
+func (j *Jar) merge(entries []entry) error {
+	for _, e := range entries {
+		if e.EncryptedValue != "" {
+			value, ok := j.decryptValue(e.EncryptedValue)
+			if !ok {
+				// No configured key decrypts the value; the cookie
+				// is skipped, so it is not in j and a later Save
+				// does not write it back.
+				continue
+			}
+			e.Value = value
+			e.EncryptedValue = ""
+		}
+		key := jarKey(e.Domain, j.psList)
+		submap := j.entries[key]
+		if submap == nil {
+			submap = make(map[string]entry)
+			j.entries[key] = submap
+		}
+		id := e.id()
+		if old, ok := submap[id]; ok && old.LastAccess.After(e.LastAccess) {
+			continue
+		}
+		submap[id] = e
+	}
+	return nil
+}
+
+// decryptValue decrypts an EncryptedValue using whichever key recognizes
+// it: the active keyring key if there is one, the legacy single-key
+// encryptedKey, or -- to allow reading cookies written under a key that
+// has since been rotated out as active -- every other key in the keyring.
+func (j *Jar) decryptValue(encryptedValue string) (string, bool) {
+	tryKeys := make([][]byte, 0, len(j.keyring)+1)
+	if key := j.valueEncryptKey(); len(key) > 0 {
+		tryKeys = append(tryKeys, key)
+	}
+	if len(j.encryptedKey) > 0 {
+		tryKeys = append(tryKeys, j.encryptedKey)
+	}
+	for id, pair := range j.keyring {
+		if id == j.activeKeyID || len(pair.EncKey) == 0 {
+			continue
+		}
+		tryKeys = append(tryKeys, pair.EncKey)
+	}
+	for _, key := range tryKeys {
+		if value, err := decrypt(encryptedValue, key); err == nil {
+			return string(value), true
+		}
+	}
+	return "", false
+}
+
+// deleteExpired removes all the persistent cookies in j that have expired
+// by now.
+func (j *Jar) deleteExpired(now time.Time) {
+	for key, submap := range j.entries {
+		for id, e := range submap {
+			if e.Persistent && !e.Expires.After(now) {
+				delete(submap, id)
+			}
+		}
+		if len(submap) == 0 {
+			delete(j.entries, key)
+		}
+	}
+}
+
+// canonicalHost strips port from host if present and returns the canonicalized
+// host name.
+func canonicalHost(host string) (string, error) {
+	var err error
+	if hasPort(host) {
+		host, _, err = net.SplitHostPort(host)
+		if err != nil {
+			return "", err
+		}
+	}
+	host = strings.TrimSuffix(host, ".")
+	encoded, err := idna.ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(encoded), nil
+}
+
+// hasPort reports whether host contains a port number. host may be a host
+// name, an IPv4 or an IPv6 address.
+func hasPort(host string) bool {
+	colons := strings.Count(host, ":")
+	if colons == 0 {
+		return false
+	}
+	if colons == 1 {
+		return true
+	}
+	return host[0] == '[' && strings.Contains(host, "]:")
+}
+
+// jarKey returns the key to use for a jar.
+func jarKey(host string, psl PublicSuffixList) string {
+	if isIP(host) {
+		return host
+	}
+
+	var i int
+	if psl == nil {
+		i = strings.LastIndex(host, ".")
+		if i <= 0 {
+			return host
+		}
+	} else {
+		suffix := psl.PublicSuffix(host)
+		if suffix == host {
+			return host
+		}
+		i = len(host) - len(suffix)
+		if i <= 0 || host[i-1] != '.' {
+			return host
+		}
+	}
+	prevDot := strings.LastIndex(host[:i-1], ".")
+	return host[prevDot+1:]
+}
+
+// isIP reports whether host is an IP address.
+func isIP(host string) bool {
+	return net.ParseIP(host) != nil
+}
+
+// defaultPath returns the directory part of a URL's path according to
+// RFC 6265 section 5.1.4.
+func defaultPath(path string) string {
+	if len(path) == 0 || path[0] != '/' {
+		return "/"
+	}
+
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// newEntry creates an entry from an http.Cookie c. now is the current time and
+// is compared to c.Expires to determine deletion of c. defPath and host are the
+// default-path and the canonical host name of the URL c was received from.
+func (j *Jar) newEntry(c *http.Cookie, now time.Time, defPath, host string) (e entry, remove bool, err error) {
+	e.Name = c.Name
+
+	if c.Path == "" || c.Path[0] != '/' {
+		e.Path = defPath
+	} else {
+		e.Path = c.Path
+	}
+
+	e.Domain, e.HostOnly, err = j.domainAndType(host, c.Domain)
+	if err != nil {
+		return e, false, err
+	}
+
+	if c.MaxAge < 0 {
+		return e, true, nil
+	} else if c.MaxAge > 0 {
+		e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		e.Persistent = true
+	} else {
+		if c.Expires.IsZero() {
+			e.Expires = endOfTime
+			e.Persistent = false
+		} else {
+			if !c.Expires.After(now) {
+				return e, true, nil
+			}
+			e.Expires = c.Expires
+			e.Persistent = true
+		}
+	}
+
+	e.Value = c.Value
+	e.Secure = c.Secure
+	e.HttpOnly = c.HttpOnly
+	e.SameSite = c.SameSite
+
+	if isPartitioned(c) {
+		e.Partitioned = true
+		e.PartitionKey = jarKey(host, j.psList)
+	}
+
+	return e, false, nil
+}
+
+// isPartitioned reports whether c was set with the CHIPS "Partitioned"
+// attribute. net/http's Cookie type predates CHIPS and doesn't surface it
+// as a dedicated field, so it shows up among the attributes net/http
+// couldn't otherwise parse.
+func isPartitioned(c *http.Cookie) bool {
+	for _, attr := range c.Unparsed {
+		if strings.EqualFold(strings.TrimSpace(attr), "Partitioned") {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	errIllegalDomain   = errors.New("cookiejar: illegal cookie domain attribute")
+	errMalformedDomain = errors.New("cookiejar: malformed cookie domain attribute")
+)
+
+// endOfTime is the time when session (non-persistent) cookies expire.
+// This instant is representable in most date/time formats (not just
+// Go's time.Time) and should be far enough in the future.
+var endOfTime = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// domainAndType determines the cookie's domain and hostOnly attribute.
+func (j *Jar) domainAndType(host, domain string) (string, bool, error) {
+	if domain == "" {
+		return host, true, nil
+	}
+
+	if isIP(host) {
+		if host != domain {
+			return "", false, errIllegalDomain
+		}
+		return host, true, nil
+	}
+
+	if domain[0] == '.' {
+		domain = domain[1:]
+	}
+
+	if len(domain) == 0 || domain[0] == '.' {
+		return "", false, errMalformedDomain
+	}
+	domain = strings.ToLower(domain)
+
+	if domain[len(domain)-1] == '.' {
+		return "", false, errMalformedDomain
+	}
+
+	if j.psList != nil {
+		if ps := j.psList.PublicSuffix(domain); ps != "" && !hasDotSuffix(domain, ps) {
+			if host == domain {
+				return host, true, nil
+			}
+			return "", false, errIllegalDomain
+		}
+	}
+
+	if host != domain && !hasDotSuffix(host, domain) {
+		return "", false, errIllegalDomain
+	}
+
+	return domain, false, nil
+}
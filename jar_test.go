@@ -0,0 +1,66 @@
+package cookiejar
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSameSiteRoundTrip(t *testing.T) {
+	j, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/")
+	j.SetCookies(u, []*http.Cookie{{
+		Name: "a", Value: "v", MaxAge: 3600, SameSite: http.SameSiteStrictMode,
+	}})
+
+	var buf bytes.Buffer
+	if err := j.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	j2, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j2.mergeFrom(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	got := j2.entries[jarKey("example.com", nil)]["example.com;/;a"]
+	if got.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("SameSite = %v, want %v", got.SameSite, http.SameSiteStrictMode)
+	}
+}
+
+func TestNewEntryRecordsPartitionedAttribute(t *testing.T) {
+	j, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &http.Cookie{Name: "p", Value: "v", Unparsed: []string{"Partitioned"}}
+	e, remove, err := j.newEntry(c, time.Now(), "/", "widget.example")
+	if err != nil || remove {
+		t.Fatalf("newEntry failed: %v, remove=%v", err, remove)
+	}
+	if !e.Partitioned || e.PartitionKey != "widget.example" {
+		t.Fatalf("got Partitioned=%v PartitionKey=%q, want true, %q", e.Partitioned, e.PartitionKey, "widget.example")
+	}
+}
+
+func TestPartitionMatchBlocksMismatchedKey(t *testing.T) {
+	e := entry{Partitioned: true, PartitionKey: "b.example"}
+	if e.partitionMatch("a.example") {
+		t.Fatal("expected partition mismatch to block the cookie")
+	}
+	if !e.partitionMatch("b.example") {
+		t.Fatal("expected matching partition key to allow the cookie")
+	}
+	unpartitioned := entry{}
+	if !unpartitioned.partitionMatch("anything") {
+		t.Fatal("expected unpartitioned cookie to always match")
+	}
+}
@@ -0,0 +1,16 @@
+package cookiejar
+
+// KeyPair holds the two keys used to protect a persisted cookie file: one
+// for encrypting cookie values (see encrypt/decrypt in serialize.go) and one
+// for authenticating the file as a whole (see the HMAC tag written by
+// writeTo). Keeping them separate means rotating the MAC key doesn't force
+// re-encrypting every cookie value, and vice versa.
+type KeyPair struct {
+	EncKey []byte
+	MacKey []byte
+}
+
+// Keyring maps a key ID to the KeyPair that was active when cookies were
+// written under that ID. It lets a Jar verify and decrypt files written
+// with an older key while new files are written with the current one.
+type Keyring map[string]KeyPair
@@ -0,0 +1,45 @@
+package cookiejar
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStorage is a Storage backend that keeps entries in process memory.
+// It persists nothing to disk, so it is only useful for tests and other
+// cases where a Jar needs a Storage but not durability across restarts.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	entries []entry
+}
+
+// NewMemoryStorage returns a Storage backed by an in-memory slice.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+// Lock implements Storage.Lock. Since MemoryStorage is already
+// synchronized internally by mu, it hands out a no-op Unlocker.
+func (s *MemoryStorage) Lock(ctx context.Context) (Unlocker, error) {
+	return noopUnlocker{}, nil
+}
+
+func (s *MemoryStorage) Load() ([]entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]entry, len(s.entries))
+	copy(entries, s.entries)
+	return entries, nil
+}
+
+func (s *MemoryStorage) Store(entries []entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make([]entry, len(entries))
+	copy(s.entries, entries)
+	return nil
+}
+
+type noopUnlocker struct{}
+
+func (noopUnlocker) Unlock() error { return nil }
@@ -0,0 +1,134 @@
+package cookiejar
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RemoteKV is the minimal key/value client a RemoteStorage needs. It is
+// satisfied by thin wrappers around typical Redis or Memcached client
+// libraries: SetNX (e.g. Redis SET key value NX PX ttl) acquires the
+// distributed lock and DelIfMatch releases it, while Get and Set move the
+// serialized cookie payload.
+type RemoteKV interface {
+	// Get returns the value stored at key, or a nil slice if key is
+	// unset.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores value at key with no expiry.
+	Set(ctx context.Context, key string, value []byte) error
+
+	// SetNX stores value at key and returns true only if key was
+	// previously unset; the entry expires after ttl so a crashed
+	// holder can't wedge the lock forever.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// Del removes key.
+	Del(ctx context.Context, key string) error
+
+	// DelIfMatch removes key only if its current value equals expected,
+	// reporting whether it did so (e.g. Redis's "compare-and-delete"
+	// EVAL/Lua pattern, or Memcached's CAS). RemoteStorage uses this to
+	// release its lock, so a holder whose TTL already expired can't
+	// delete a different holder's lock that has since replaced it.
+	DelIfMatch(ctx context.Context, key string, expected []byte) (bool, error)
+}
+
+// RemoteStorage is a Storage backend for a shared key/value store such as
+// Redis or Memcached, so that multiple processes -- potentially on
+// different machines -- can work from the same cookie jar without each
+// needing its own copy of the file.
+type RemoteStorage struct {
+	kv           RemoteKV
+	key          string
+	lockTTL      time.Duration
+	pollInterval time.Duration
+	keyring      Keyring
+	activeKeyID  string
+}
+
+// NewRemoteStorage returns a Storage backed by kv, storing the cookie
+// payload at key and using key+".lock" to coordinate writers.
+func NewRemoteStorage(kv RemoteKV, key string, keyring Keyring, activeKeyID string) *RemoteStorage {
+	return &RemoteStorage{
+		kv:           kv,
+		key:          key,
+		lockTTL:      10 * time.Second,
+		pollInterval: 20 * time.Millisecond,
+		keyring:      keyring,
+		activeKeyID:  activeKeyID,
+	}
+}
+
+type remoteUnlocker struct {
+	kv      RemoteKV
+	lockKey string
+	token   []byte
+}
+
+func (u remoteUnlocker) Unlock() error {
+	_, err := u.kv.DelIfMatch(context.Background(), u.lockKey, u.token)
+	return err
+}
+
+// Lock polls SetNX until it wins the lock or ctx is done. It stores a
+// random fencing token as the lock's value so that Unlock (via
+// DelIfMatch) only ever removes the lock it itself acquired, even if
+// its TTL has since expired and another holder has taken over the key.
+func (s *RemoteStorage) Lock(ctx context.Context) (Unlocker, error) {
+	lockKey := s.key + ".lock"
+	token, err := randomLockToken()
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot generate lock token")
+	}
+	for {
+		ok, err := s.kv.SetNX(ctx, lockKey, token, s.lockTTL)
+		if err != nil {
+			return nil, errors.WithMessage(err, "cannot acquire remote cookie lock")
+		}
+		if ok {
+			return remoteUnlocker{s.kv, lockKey, token}, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
+
+// randomLockToken returns a value unique enough to serve as a lock's
+// fencing token.
+func randomLockToken() ([]byte, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	token := make([]byte, hex.EncodedLen(len(raw)))
+	hex.Encode(token, raw)
+	return token, nil
+}
+
+func (s *RemoteStorage) Load() ([]entry, error) {
+	data, err := s.kv.Get(context.Background(), s.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return decodeEnvelope(bytes.NewReader(data), s.keyring)
+}
+
+func (s *RemoteStorage) Store(entries []entry) error {
+	var buf bytes.Buffer
+	if err := encodeEnvelope(&buf, entries, s.keyring, s.activeKeyID); err != nil {
+		return err
+	}
+	return s.kv.Set(context.Background(), s.key, buf.Bytes())
+}
@@ -0,0 +1,175 @@
+package cookiejar
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memKV is an in-memory RemoteKV good enough to exercise RemoteStorage
+// in tests: it tracks a per-key expiry so SetNX's ttl can actually lapse.
+type memKV struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	expires map[string]time.Time
+}
+
+func newMemKV() *memKV {
+	return &memKV{
+		values:  make(map[string][]byte),
+		expires: make(map[string]time.Time),
+	}
+}
+
+func (m *memKV) expireLocked(key string) {
+	if exp, ok := m.expires[key]; ok && time.Now().After(exp) {
+		delete(m.values, key)
+		delete(m.expires, key)
+	}
+}
+
+func (m *memKV) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expireLocked(key)
+	return m.values[key], nil
+}
+
+func (m *memKV) Set(ctx context.Context, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = append([]byte{}, value...)
+	delete(m.expires, key)
+	return nil
+}
+
+func (m *memKV) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expireLocked(key)
+	if _, exists := m.values[key]; exists {
+		return false, nil
+	}
+	m.values[key] = append([]byte{}, value...)
+	if ttl > 0 {
+		m.expires[key] = time.Now().Add(ttl)
+	}
+	return true, nil
+}
+
+func (m *memKV) Del(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	delete(m.expires, key)
+	return nil
+}
+
+func (m *memKV) DelIfMatch(ctx context.Context, key string, expected []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expireLocked(key)
+	if !bytes.Equal(m.values[key], expected) {
+		return false, nil
+	}
+	delete(m.values, key)
+	delete(m.expires, key)
+	return true, nil
+}
+
+func TestRemoteStorageSaveLoadRoundTrip(t *testing.T) {
+	kv := newMemKV()
+	storage := NewRemoteStorage(kv, "cookies", nil, "")
+
+	j, err := New(&Options{Storage: storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/")
+	j.SetCookies(u, []*http.Cookie{{Name: "a", Value: "v", MaxAge: 3600}})
+	if err := j.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	j2, err := New(&Options{Storage: NewRemoteStorage(kv, "cookies", nil, "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := j2.Cookies(u)
+	if len(got) != 1 || got[0].Value != "v" {
+		t.Fatalf("got %#v, want one cookie with value %q", got, "v")
+	}
+}
+
+func TestRemoteStorageLockIsExclusive(t *testing.T) {
+	kv := newMemKV()
+	concurrentCount := int64(0)
+	var wg sync.WaitGroup
+	locker := func() {
+		defer wg.Done()
+		s := NewRemoteStorage(kv, "cookies", nil, "")
+		unlock, err := s.Lock(context.Background())
+		if err != nil {
+			t.Errorf("cannot obtain lock: %v", err)
+			return
+		}
+		x := atomic.AddInt64(&concurrentCount, 1)
+		if x > 1 {
+			t.Errorf("multiple locks held at one time")
+		}
+		defer unlock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt64(&concurrentCount, -1)
+	}
+	wg.Add(4)
+	for i := 0; i < 4; i++ {
+		go locker()
+	}
+	wg.Wait()
+	if concurrentCount != 0 {
+		t.Errorf("expected no running goroutines left")
+	}
+}
+
+func TestRemoteStorageUnlockDoesNotDeleteAnotherHoldersLock(t *testing.T) {
+	kv := newMemKV()
+
+	s1 := NewRemoteStorage(kv, "cookies", nil, "")
+	s1.lockTTL = 10 * time.Millisecond
+	unlock1, err := s1.Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Let s1's lock TTL lapse, as if it had stalled past its deadline.
+	time.Sleep(20 * time.Millisecond)
+
+	s2 := NewRemoteStorage(kv, "cookies", nil, "")
+	s2.lockTTL = 10 * time.Second
+	unlock2, err := s2.Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// s1 finally gets around to releasing what it thinks is its lock.
+	// Without a fencing token this would delete s2's still-live lock.
+	if err := unlock1.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	s3 := NewRemoteStorage(kv, "cookies", nil, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s3.Lock(ctx); err == nil {
+		t.Fatal("expected s3 to fail to acquire a lock still legitimately held by s2")
+	}
+
+	if err := unlock2.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,16 +6,17 @@ package cookiejar
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
-	"github.com/cascax/persistent-cookiejar/internal"
 	"io"
 	"log"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -23,14 +24,45 @@ import (
 	"github.com/pkg/errors"
 )
 
-// Save saves the cookies to the persistent cookie file.
-// Before the file is written, it reads any cookies that
-// have been stored from it and merges them into j.
+// formatVersion is the version written to the "version" field of the
+// on-disk envelope. It is bumped whenever the envelope or entry shape
+// changes in a way that readers need to know about.
+//
+// 3 added typed SameSite and Partitioned/PartitionKey to entry; see
+// entry.UnmarshalJSON for how older files with a string SameSite decode.
+const formatVersion = 3
+
+// fileEnvelope is the self-describing header wrapped around the JSON
+// array of entries on disk. Older files (formatVersion 1 and below)
+// are a bare JSON array with no envelope at all; mergeFrom detects and
+// migrates those transparently.
+//
+// Payload is authenticated (but not necessarily encrypted -- per-value
+// encryption of Value is handled separately by encrypt/decrypt) by MAC,
+// an HMAC-SHA256 of Payload keyed by the MacKey named by KeyID. This
+// protects the cleartext entry fields (Domain, Path, Expires, ...) that
+// per-value encryption alone leaves exposed and tamperable.
+type fileEnvelope struct {
+	Version int             `json:"version"`
+	KeyID   string          `json:"key_id,omitempty"`
+	MAC     string          `json:"mac,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Save saves the cookies to the Jar's Storage.
+// Before the storage is written, it reads any cookies that
+// have been stored there and merges them into j.
 func (j *Jar) Save() error {
-	if j.filename == "" {
+	return j.SaveContext(context.Background())
+}
+
+// SaveContext is like Save but allows a save blocked waiting for the
+// Storage lock to be cancelled via ctx.
+func (j *Jar) SaveContext(ctx context.Context) error {
+	if j.storage == nil {
 		return nil
 	}
-	return j.save(time.Now())
+	return j.save(ctx, time.Now())
 }
 
 // MarshalJSON implements json.Marshaler by encoding all persistent cookies
@@ -47,101 +79,181 @@ func (j *Jar) MarshalJSON() ([]byte, error) {
 	return data, nil
 }
 
-// save is like Save but takes the current time as a parameter.
-func (j *Jar) save(now time.Time) error {
-	locked, err := internal.LockFile(j.filename)
-	if err != nil {
-		return err
-	}
-	defer locked.Close()
-	f, err := os.OpenFile(j.filename, os.O_RDWR|os.O_CREATE, 0600)
+// save is like Save but takes a context and the current time as
+// parameters.
+func (j *Jar) save(ctx context.Context, now time.Time) error {
+	unlock, err := j.storage.Lock(ctx)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	// TODO optimization: if the file hasn't changed since we
-	// loaded it, don't bother with the merge step.
+	defer unlock.Unlock()
 
 	j.mu.Lock()
 	defer j.mu.Unlock()
-	if err := j.mergeFrom(f); err != nil {
-		// The cookie file is probably corrupt.
-		log.Printf("cannot read cookie file to merge it; ignoring it: %v", err)
+	if !j.storageChanged() {
+		// Nothing else has written to storage since we last loaded
+		// or stored it, so there's nothing to merge.
+	} else if entries, err := j.storage.Load(); err != nil {
+		// The cookie storage is probably corrupt.
+		log.Printf("cannot read cookie storage to merge it; ignoring it: %v", err)
+	} else if err := j.merge(entries); err != nil {
+		return err
 	}
 	j.deleteExpired(now)
-	if err := f.Truncate(0); err != nil {
-		return errors.WithMessage(err, "cannot truncate file")
-	}
-	if _, err := f.Seek(0, 0); err != nil {
+	entries, err := j.allPersistentEntries()
+	if err != nil {
 		return err
 	}
-	return j.writeTo(f)
+	return j.storage.Store(entries)
 }
 
-// load loads the cookies from j.filename. If the file does not exist,
-// no error will be returned and no cookies will be loaded.
-func (j *Jar) load() error {
-	if _, err := os.Stat(filepath.Dir(j.filename)); os.IsNotExist(err) {
-		// The directory that we'll store the cookie jar
-		// in doesn't exist, so don't bother trying
-		// to acquire the lock.
-		return nil
+// storageChanged reports whether j.storage needs to be Load'd and merged
+// before this save. If storage doesn't implement ChangeDetector, or
+// reports an error, it fails open and treats storage as changed.
+func (j *Jar) storageChanged() bool {
+	detector, ok := j.storage.(ChangeDetector)
+	if !ok {
+		return true
 	}
-	locked, err := internal.LockFile(j.filename)
+	changed, err := detector.Changed()
 	if err != nil {
-		return err
+		return true
 	}
-	defer locked.Close()
-	f, err := os.Open(j.filename)
+	return changed
+}
+
+// load loads the cookies from j.storage. If storage has never been
+// written to, no error will be returned and no cookies will be loaded.
+func (j *Jar) load() error {
+	return j.loadContext(context.Background())
+}
+
+// loadContext is like load but allows a load blocked waiting for the
+// Storage lock to be cancelled via ctx.
+func (j *Jar) loadContext(ctx context.Context) error {
+	unlock, err := j.storage.Lock(ctx)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return err
 	}
-	defer f.Close()
-	if err := j.mergeFrom(f); err != nil {
+	defer unlock.Unlock()
+	entries, err := j.storage.Load()
+	if err != nil {
 		return err
 	}
-	return nil
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.merge(entries)
 }
 
 // mergeFrom reads all the cookies from r and stores them in the Jar.
+//
+// It understands both the current authenticated envelope format and the
+// bare-JSON-array format written by versions prior to the introduction of
+// fileEnvelope, so that existing cookie files upgrade transparently the
+// next time they're saved.
 func (j *Jar) mergeFrom(r io.Reader) error {
+	entries, err := decodeEnvelope(r, j.keyring)
+	if err != nil {
+		return err
+	}
+	return j.merge(entries)
+}
+
+// decodeEnvelope reads a fileEnvelope (or, for backwards compatibility, a
+// bare JSON array of entries) from r, verifies its MAC against keyring in
+// constant time if one is present, and returns the decoded entries.
+func decodeEnvelope(r io.Reader, keyring Keyring) ([]entry, error) {
 	decoder := json.NewDecoder(r)
-	// Cope with old cookiejar format by just discarding
-	// cookies, but still return an error if it's invalid JSON.
 	var data json.RawMessage
 	if err := decoder.Decode(&data); err != nil {
 		if err == io.EOF {
-			// Empty file.
-			return nil
+			// Empty storage.
+			return nil, nil
 		}
-		return err
+		return nil, err
+	}
+	payload, err := verifyEnvelope(data, keyring)
+	if err != nil {
+		return nil, err
 	}
 	var entries []entry
-	if err := json.Unmarshal(data, &entries); err != nil {
+	if err := json.Unmarshal(payload, &entries); err != nil {
 		log.Printf("warning: discarding cookies in invalid format (error: %v)", err)
-		return nil
+		return nil, nil
 	}
-	if err := j.merge(entries); err != nil {
-		return err
+	return entries, nil
+}
+
+// verifyEnvelope recognises the fileEnvelope wrapper, verifies its MAC
+// (if any) in constant time and returns the raw entries payload. If data
+// is not an envelope -- i.e. it's the bare JSON array written by the
+// pre-envelope format -- it is returned unchanged, since it has neither a
+// key ID nor a MAC to check.
+func verifyEnvelope(data json.RawMessage, keyring Keyring) (json.RawMessage, error) {
+	var env fileEnvelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Version == 0 {
+		// Not an envelope: this is a plaintext/v01-only file from
+		// before envelopes existed. Load it as-is; the next Save
+		// rewrites it in the current format.
+		return data, nil
+	}
+	if env.MAC == "" {
+		if len(keyring) > 0 {
+			return nil, errors.New("cookie file has no MAC but a keyring is configured")
+		}
+		// No keyring configured; nothing to verify against.
+		return env.Payload, nil
+	}
+	keys, ok := keyring[env.KeyID]
+	if !ok {
+		return nil, errors.Errorf("cookie file was signed with unknown key ID %q", env.KeyID)
 	}
-	return nil
+	wantMAC, err := hex.DecodeString(env.MAC)
+	if err != nil {
+		return nil, errors.WithMessage(err, "malformed MAC")
+	}
+	if !hmac.Equal(wantMAC, macPayload(env.Payload, keys.MacKey)) {
+		return nil, errors.New("cookie file failed MAC verification")
+	}
+	return env.Payload, nil
 }
 
-// writeTo writes all the cookies in the jar to w
-// as a JSON array.
+// macPayload returns the HMAC-SHA256 of payload keyed by macKey.
+func macPayload(payload json.RawMessage, macKey []byte) []byte {
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// writeTo writes all the cookies in the jar to w, wrapped in the current
+// fileEnvelope. If j.keyring is set, the payload is authenticated with an
+// HMAC-SHA256 tag keyed by the active key, so that operators can rotate
+// keys (by changing ActiveKeyID) without invalidating files signed under
+// older key IDs still present in the keyring.
 func (j *Jar) writeTo(w io.Writer) error {
-	encoder := json.NewEncoder(w)
 	entries, err := j.allPersistentEntries()
 	if err != nil {
 		return err
 	}
-	if err := encoder.Encode(entries); err != nil {
+	return encodeEnvelope(w, entries, j.keyring, j.activeKeyID)
+}
+
+// encodeEnvelope writes entries to w wrapped in a fileEnvelope, signing
+// the payload with keyring[activeKeyID] if keyring is non-empty.
+func encodeEnvelope(w io.Writer, entries []entry, keyring Keyring, activeKeyID string) error {
+	payload, err := json.Marshal(entries)
+	if err != nil {
 		return err
 	}
-	return nil
+	env := fileEnvelope{
+		Version: formatVersion,
+		Payload: payload,
+	}
+	if len(keyring) > 0 {
+		env.KeyID = activeKeyID
+		env.MAC = hex.EncodeToString(macPayload(payload, keyring[activeKeyID].MacKey))
+	}
+	return json.NewEncoder(w).Encode(env)
 }
 
 // allPersistentEntries returns all the entries in the jar, sorted by primarly by canonical host
@@ -152,8 +264,8 @@ func (j *Jar) allPersistentEntries() ([]entry, error) {
 	for _, submap := range j.entries {
 		for _, e := range submap {
 			if e.Persistent {
-				if len(j.encryptedKey) > 0 {
-					e.EncryptedValue, err = encrypt([]byte(e.Value), j.encryptedKey)
+				if encKey := j.valueEncryptKey(); len(encKey) > 0 {
+					e.EncryptedValue, err = encrypt([]byte(e.Value), encKey)
 					if err != nil {
 						return nil, errors.WithMessage(err, "encrypt value error")
 					}
@@ -167,6 +279,17 @@ func (j *Jar) allPersistentEntries() ([]entry, error) {
 	return entries, nil
 }
 
+// valueEncryptKey returns the key used to encrypt individual cookie
+// values, preferring the active keyring entry (so value encryption
+// rotates along with the envelope's signing key) and falling back to the
+// legacy single-key encryptedKey field.
+func (j *Jar) valueEncryptKey() []byte {
+	if len(j.keyring) > 0 {
+		return j.keyring[j.activeKeyID].EncKey
+	}
+	return j.encryptedKey
+}
+
 // encrypt returns the text encrypted by AES-GCM and encoded by base64
 func encrypt(plaintext []byte, key []byte) (string, error) {
 	block, err := aes.NewCipher(key)
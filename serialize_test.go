@@ -0,0 +1,105 @@
+package cookiejar
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func testKeyring() (Keyring, string) {
+	return Keyring{
+		"k1": {
+			EncKey: []byte("0123456789abcdef0123456789abcdef"[:16]),
+			MacKey: []byte("fedcba9876543210fedcba9876543210"[:32]),
+		},
+	}, "k1"
+}
+
+func TestSaveLoadRoundTripWithKeyring(t *testing.T) {
+	keyring, activeID := testKeyring()
+	j, err := New(&Options{Keyring: keyring, ActiveKeyID: activeID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/")
+	j.SetCookies(u, []*http.Cookie{{
+		Name: "a", Value: "secret", MaxAge: 3600,
+	}})
+
+	var buf bytes.Buffer
+	if err := j.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	j2, err := New(&Options{Keyring: keyring, ActiveKeyID: activeID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j2.mergeFrom(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	got := j2.cookies(u, time.Now())
+	if len(got) != 1 || got[0].Value != "secret" {
+		t.Fatalf("got %#v, want one cookie with value %q", got, "secret")
+	}
+}
+
+func TestMergeFromRejectsTamperedEnvelope(t *testing.T) {
+	keyring, activeID := testKeyring()
+	j, err := New(&Options{Keyring: keyring, ActiveKeyID: activeID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/")
+	j.SetCookies(u, []*http.Cookie{{Name: "a", Value: "v", MaxAge: 3600}})
+
+	var buf bytes.Buffer
+	if err := j.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(buf.Bytes(), []byte(`"a"`), []byte(`"b"`), 1)
+
+	j2, err := New(&Options{Keyring: keyring, ActiveKeyID: activeID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j2.mergeFrom(bytes.NewReader(tampered)); err == nil {
+		t.Fatal("expected MAC verification to fail on tampered file")
+	}
+}
+
+func TestMergeFromRejectsEnvelopeWithoutMACWhenKeyringConfigured(t *testing.T) {
+	keyring, activeID := testKeyring()
+	j, err := New(&Options{Keyring: keyring, ActiveKeyID: activeID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An envelope-shaped payload with no "mac" field at all: forging this
+	// should not be accepted just because the attacker omitted the MAC.
+	forged := []byte(`{"version":3,"payload":[{"Name":"session","Value":"attacker-value","Domain":"example.com","Path":"/","Persistent":true,"HostOnly":true,"Expires":"9999-12-31T23:59:59Z"}]}`)
+	if err := j.mergeFrom(bytes.NewReader(forged)); err == nil {
+		t.Fatal("expected mergeFrom to reject an unsigned envelope when a keyring is configured")
+	}
+	u, _ := url.Parse("https://example.com/")
+	if got := j.cookies(u, time.Now()); len(got) != 0 {
+		t.Fatalf("forged cookie was loaded: %#v", got)
+	}
+}
+
+func TestMergeFromMigratesLegacyPlainArray(t *testing.T) {
+	j, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := []byte(`[{"Name":"a","Value":"v","Domain":"example.com","Path":"/","Persistent":true,"HostOnly":true,"Expires":"9999-12-31T23:59:59Z"}]`)
+	if err := j.mergeFrom(bytes.NewReader(legacy)); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/")
+	got := j.cookies(u, time.Now())
+	if len(got) != 1 || got[0].Value != "v" {
+		t.Fatalf("got %#v, want one cookie with value %q", got, "v")
+	}
+}
@@ -0,0 +1,45 @@
+package cookiejar
+
+import "context"
+
+// Unlocker releases a lock acquired from Storage.Lock.
+type Unlocker interface {
+	Unlock() error
+}
+
+// Storage is the persistence backend behind a Jar. The default backend
+// (see newFileStorage) stores cookies in a local file guarded by an
+// flock-style lock, but a Jar can be pointed at any implementation --
+// e.g. a shared key/value store -- so that multiple processes, or even
+// multiple machines, can safely work from the same set of cookies.
+//
+// Lock must be held for the duration of a read-modify-write cycle: a
+// typical Save calls Lock, then Load, merges in any cookies another
+// process wrote in the meantime, then Store, then releases the lock.
+type Storage interface {
+	// Lock acquires exclusive access to the underlying cookies,
+	// blocking (subject to ctx) until it is available. The returned
+	// Unlocker must be released once the caller is done.
+	Lock(ctx context.Context) (Unlocker, error)
+
+	// Load returns the entries currently in storage. It returns a nil
+	// slice, with no error, if storage has never been written to.
+	Load() ([]entry, error)
+
+	// Store replaces the entries in storage with entries.
+	Store(entries []entry) error
+}
+
+// ChangeDetector is an optional interface a Storage may implement to
+// report whether its underlying data has changed since it was last Load
+// or Store'd. When a Storage implements it, save uses it to skip the
+// Load-and-merge step entirely when nothing else has written to storage
+// since this Jar last touched it.
+type ChangeDetector interface {
+	// Changed reports whether the data behind Storage may have changed
+	// since the last Load or Store call. A false positive (reporting
+	// changed when it hasn't) only costs a redundant merge; a false
+	// negative would lose another process's writes, so implementations
+	// should fail open (report true) whenever they're unsure.
+	Changed() (bool, error)
+}
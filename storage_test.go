@@ -0,0 +1,29 @@
+package cookiejar
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestJarWithMemoryStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	j, err := New(&Options{Storage: storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/")
+	j.SetCookies(u, []*http.Cookie{{Name: "a", Value: "v", MaxAge: 3600}})
+	if err := j.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	j2, err := New(&Options{Storage: storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := j2.Cookies(u)
+	if len(got) != 1 || got[0].Value != "v" {
+		t.Fatalf("got %#v, want one cookie with value %q", got, "v")
+	}
+}